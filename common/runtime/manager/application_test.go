@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2019-2022. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package manager
+
+import (
+	"testing"
+
+	"github.com/pydio/cells/v4/common/service"
+)
+
+func newTestManager() *manager {
+	return &manager{
+		metadataReport: newMemMetadataReport(),
+		applications:   make(map[string]*Application),
+		serviceApps:    make(map[string]string),
+	}
+}
+
+func TestNotifyApplicationSendsCopyNotSharedPointer(t *testing.T) {
+	m := newTestManager()
+	ch := m.SubscribeApplications()
+
+	if er := m.RegisterApplication("app1", []service.Service{fakeMetricsService{name: "svc1"}}); er != nil {
+		t.Fatalf("RegisterApplication: %v", er)
+	}
+
+	snapshot := <-ch
+	if snapshot.AppID != "app1" || len(snapshot.Services) != 1 {
+		t.Fatalf("unexpected snapshot: %+v", snapshot)
+	}
+
+	m.appsMu.Lock()
+	live := m.applications["app1"]
+	live.Services = append(live.Services, fakeMetricsService{name: "svc2"})
+	m.appsMu.Unlock()
+
+	if len(snapshot.Services) != 1 {
+		t.Fatalf("mutating the live Application should not affect an already-delivered snapshot, got %d services", len(snapshot.Services))
+	}
+}
+
+func TestMemMetadataReportPutGet(t *testing.T) {
+	r := newMemMetadataReport()
+	if er := r.Put("app1", "inst1", map[string]string{"name": "svc1"}); er != nil {
+		t.Fatalf("Put: %v", er)
+	}
+	if er := r.Put("app1", "inst2", map[string]string{"name": "svc2"}); er != nil {
+		t.Fatalf("Put: %v", er)
+	}
+
+	got, er := r.Get("app1")
+	if er != nil {
+		t.Fatalf("Get: %v", er)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 instances, got %d", len(got))
+	}
+	if got["inst1"]["name"] != "svc1" || got["inst2"]["name"] != "svc2" {
+		t.Fatalf("unexpected instance metadata: %v", got)
+	}
+}
+
+func TestMemMetadataReportGetUnknownApp(t *testing.T) {
+	r := newMemMetadataReport()
+	got, er := r.Get("does-not-exist")
+	if er != nil {
+		t.Fatalf("Get: %v", er)
+	}
+	if len(got) != 0 {
+		t.Fatalf("expected no instances for an unknown app, got %v", got)
+	}
+}
+
+func TestMemMetadataReportDelete(t *testing.T) {
+	r := newMemMetadataReport()
+	_ = r.Put("app1", "inst1", map[string]string{"name": "svc1"})
+	_ = r.Put("app1", "inst2", map[string]string{"name": "svc2"})
+
+	if er := r.Delete("app1", "inst1"); er != nil {
+		t.Fatalf("Delete: %v", er)
+	}
+
+	got, _ := r.Get("app1")
+	if _, ok := got["inst1"]; ok {
+		t.Fatalf("expected inst1 to be gone after Delete, got %v", got)
+	}
+	if _, ok := got["inst2"]; !ok {
+		t.Fatalf("expected inst2 to survive Delete of inst1, got %v", got)
+	}
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright (c) 2019-2022. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package manager
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pydio/cells/v4/common/server"
+	"github.com/pydio/cells/v4/common/service"
+)
+
+// EventKind identifies the stage of a manager lifecycle event.
+type EventKind int
+
+const (
+	BeforeStart EventKind = iota
+	AfterStart
+	BeforeStop
+	AfterStop
+	RestartRequested
+	UniquePostponed
+	LeaseLost
+	Promoted
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case BeforeStart:
+		return "BeforeStart"
+	case AfterStart:
+		return "AfterStart"
+	case BeforeStop:
+		return "BeforeStop"
+	case AfterStop:
+		return "AfterStop"
+	case RestartRequested:
+		return "RestartRequested"
+	case UniquePostponed:
+		return "UniquePostponed"
+	case LeaseLost:
+		return "LeaseLost"
+	case Promoted:
+		return "Promoted"
+	default:
+		return "Unknown"
+	}
+}
+
+// LifecycleEvent carries the context of a single manager lifecycle stage to
+// its listeners.
+type LifecycleEvent struct {
+	Kind    EventKind
+	Service service.Service
+	Server  server.Server
+	Err     error
+	At      time.Time
+}
+
+// ListenerOption customizes how a listener is registered via AddListener.
+type ListenerOption func(*eventListener)
+
+// WithPriority orders listeners for the same EventKind: lower runs first.
+// Listeners registered with the same priority keep their registration order.
+func WithPriority(p int) ListenerOption {
+	return func(l *eventListener) {
+		l.priority = p
+	}
+}
+
+// Async delivers the event to this listener on its own goroutine instead of
+// blocking the dispatcher.
+func Async() ListenerOption {
+	return func(l *eventListener) {
+		l.async = true
+	}
+}
+
+type eventListener struct {
+	id       int
+	priority int
+	async    bool
+	fn       func(LifecycleEvent)
+}
+
+// eventBus is a small in-process, prioritized pub/sub used to decouple the
+// manager's lifecycle from anything that wants to observe it (metrics,
+// audit, tracing, the broker bridge...).
+type eventBus struct {
+	mu        sync.Mutex
+	nextID    int
+	listeners map[EventKind][]*eventListener
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{listeners: make(map[EventKind][]*eventListener)}
+}
+
+// AddListener registers fn to run on events of kind, returning an id that
+// can later be passed to RemoveListener.
+func (b *eventBus) AddListener(kind EventKind, fn func(LifecycleEvent), oo ...ListenerOption) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextID++
+	l := &eventListener{id: b.nextID, fn: fn}
+	for _, o := range oo {
+		o(l)
+	}
+	ll := append(b.listeners[kind], l)
+	sort.SliceStable(ll, func(i, j int) bool { return ll[i].priority < ll[j].priority })
+	b.listeners[kind] = ll
+	return l.id
+}
+
+// RemoveListener unregisters a listener previously returned by AddListener.
+func (b *eventBus) RemoveListener(kind EventKind, id int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ll := b.listeners[kind]
+	for i, l := range ll {
+		if l.id == id {
+			b.listeners[kind] = append(ll[:i:i], ll[i+1:]...)
+			return
+		}
+	}
+}
+
+func (b *eventBus) dispatch(ev LifecycleEvent) {
+	b.mu.Lock()
+	ll := append([]*eventListener{}, b.listeners[ev.Kind]...)
+	b.mu.Unlock()
+	for _, l := range ll {
+		if l.async {
+			go l.fn(ev)
+		} else {
+			l.fn(ev)
+		}
+	}
+}
+
+// AddListener registers fn to run on events of kind, returning an id that
+// can later be passed to RemoveListener.
+func (m *manager) AddListener(kind EventKind, fn func(LifecycleEvent), oo ...ListenerOption) int {
+	return m.events.AddListener(kind, fn, oo...)
+}
+
+// RemoveListener unregisters a listener previously returned by AddListener.
+func (m *manager) RemoveListener(kind EventKind, id int) {
+	m.events.RemoveListener(kind, id)
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2019-2022. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package manager
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEventBusPriorityOrder(t *testing.T) {
+	b := newEventBus()
+	var mu sync.Mutex
+	var order []string
+
+	b.AddListener(BeforeStart, func(LifecycleEvent) {
+		mu.Lock()
+		order = append(order, "second")
+		mu.Unlock()
+	}, WithPriority(10))
+	b.AddListener(BeforeStart, func(LifecycleEvent) {
+		mu.Lock()
+		order = append(order, "first")
+		mu.Unlock()
+	}, WithPriority(-10))
+	b.AddListener(BeforeStart, func(LifecycleEvent) {
+		mu.Lock()
+		order = append(order, "third")
+		mu.Unlock()
+	}, WithPriority(10))
+
+	b.dispatch(LifecycleEvent{Kind: BeforeStart, At: time.Now()})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(order) != 3 || order[0] != "first" || order[1] != "second" || order[2] != "third" {
+		t.Fatalf("unexpected dispatch order: %v", order)
+	}
+}
+
+func TestEventBusDispatchOnlyMatchingKind(t *testing.T) {
+	b := newEventBus()
+	var calls int
+	b.AddListener(AfterStart, func(LifecycleEvent) { calls++ })
+
+	b.dispatch(LifecycleEvent{Kind: BeforeStart, At: time.Now()})
+	if calls != 0 {
+		t.Fatalf("listener for AfterStart should not run on BeforeStart, got %d calls", calls)
+	}
+
+	b.dispatch(LifecycleEvent{Kind: AfterStart, At: time.Now()})
+	if calls != 1 {
+		t.Fatalf("expected 1 call, got %d", calls)
+	}
+}
+
+func TestEventBusRemoveListener(t *testing.T) {
+	b := newEventBus()
+	var calls int
+	id := b.AddListener(RestartRequested, func(LifecycleEvent) { calls++ })
+
+	b.dispatch(LifecycleEvent{Kind: RestartRequested, At: time.Now()})
+	b.RemoveListener(RestartRequested, id)
+	b.dispatch(LifecycleEvent{Kind: RestartRequested, At: time.Now()})
+
+	if calls != 1 {
+		t.Fatalf("expected listener to fire once before removal, got %d calls", calls)
+	}
+}
+
+func TestEventBusAsyncDoesNotBlockDispatch(t *testing.T) {
+	b := newEventBus()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	b.AddListener(LeaseLost, func(LifecycleEvent) {
+		close(started)
+		<-release
+	}, Async())
+
+	done := make(chan struct{})
+	go func() {
+		b.dispatch(LifecycleEvent{Kind: LeaseLost, At: time.Now()})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("dispatch of an async listener should not block")
+	}
+
+	<-started
+	close(release)
+}
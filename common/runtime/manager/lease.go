@@ -0,0 +1,207 @@
+/*
+ * Copyright (c) 2019-2022. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package manager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pydio/cells/v4/common"
+	"github.com/pydio/cells/v4/common/broker"
+	pb "github.com/pydio/cells/v4/common/proto/registry"
+	"github.com/pydio/cells/v4/common/registry"
+	"github.com/pydio/cells/v4/common/server"
+	"github.com/pydio/cells/v4/common/service"
+)
+
+// MetaLeaseExpiry is the item metadata key holding the RFC3339 timestamp
+// after which, absent a renewal, an item is considered orphaned.
+const MetaLeaseExpiry = "leaseExpiry"
+
+// DefaultLeaseTTL is used when WithLeaseTTL is not passed to NewManager.
+const DefaultLeaseTTL = 15 * time.Second
+
+// lease tracks the keep-alive goroutine backing a single registered item.
+type lease struct {
+	itemID string
+	cancel context.CancelFunc
+}
+
+// leaseRenewFunc persists a fresh expiry for the leased item, e.g. by
+// re-registering it or refreshing the edge metadata that tracks it.
+type leaseRenewFunc func(expiry time.Time) error
+
+// WithLeaseTTL overrides the default 15s lease TTL used for services and
+// servers registered by Init.
+func WithLeaseTTL(ttl time.Duration) Option {
+	return func(m *manager) {
+		m.leaseTTL = ttl
+	}
+}
+
+// WithLeaseReaper enables a background goroutine that deregisters nodes,
+// services and edges whose lease has expired. It can safely run on every
+// manager instance in a cluster.
+func WithLeaseReaper(enabled bool) Option {
+	return func(m *manager) {
+		m.leaseReaper = enabled
+	}
+}
+
+// acquireLease persists a lease expiry for itemID via renew and starts a
+// goroutine calling renew again at ttl/3 until ctx is canceled or revokeLease
+// is called. Backends without native TTL support still benefit, as the
+// reaper relies solely on this heartbeat metadata.
+func (m *manager) acquireLease(ctx context.Context, itemID string, ttl time.Duration, renew leaseRenewFunc) *lease {
+	lctx, cancel := context.WithCancel(ctx)
+	l := &lease{itemID: itemID, cancel: cancel}
+
+	doRenew := func() {
+		_ = renew(time.Now().Add(ttl))
+	}
+	doRenew()
+
+	go func() {
+		t := time.NewTicker(ttl / 3)
+		defer t.Stop()
+		for {
+			select {
+			case <-lctx.Done():
+				return
+			case <-t.C:
+				doRenew()
+			}
+		}
+	}()
+
+	m.leasesMu.Lock()
+	m.leases[itemID] = l
+	m.leasesMu.Unlock()
+	return l
+}
+
+// acquireItemLease is a convenience wrapper for leasing a registry.Item that
+// is kept alive by re-registering it with fresh expiry metadata.
+func (m *manager) acquireItemLease(ctx context.Context, item registry.Item, ttl time.Duration) *lease {
+	return m.acquireLease(ctx, item.ID(), ttl, func(expiry time.Time) error {
+		return m.reg.Register(item, registry.WithMeta(map[string]string{
+			MetaLeaseExpiry: expiry.Format(time.RFC3339),
+		}))
+	})
+}
+
+// revokeLease stops renewing a single lease, e.g. when its item is being
+// stopped cleanly and does not need to wait out the reaper.
+func (m *manager) revokeLease(itemID string) {
+	m.leasesMu.Lock()
+	l, ok := m.leases[itemID]
+	delete(m.leases, itemID)
+	m.leasesMu.Unlock()
+	if ok {
+		l.cancel()
+	}
+}
+
+// revokeAllLeases is called from StopAll so that a clean shutdown does not
+// wait for leases to expire before the reaper notices.
+func (m *manager) revokeAllLeases() {
+	m.leasesMu.Lock()
+	ll := m.leases
+	m.leases = make(map[string]*lease)
+	m.leasesMu.Unlock()
+	for _, l := range ll {
+		l.cancel()
+	}
+}
+
+// runLeaseReaper scans nodes, servers and services on an interval, expiring
+// anything whose lease metadata is in the past. Safe to run concurrently
+// from several manager instances.
+func (m *manager) runLeaseReaper(ctx context.Context) {
+	t := time.NewTicker(m.leaseTTL)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			m.reapExpired(pb.ItemType_NODE)
+			m.reapExpired(pb.ItemType_SERVER)
+			m.reapExpired(pb.ItemType_SERVICE)
+		}
+	}
+}
+
+// leaseExpired reports whether an item carrying meta has a MetaLeaseExpiry
+// in the past relative to now. Items without lease metadata are never
+// considered expired.
+func leaseExpired(meta map[string]string, now time.Time) bool {
+	exp, ok := meta[MetaLeaseExpiry]
+	if !ok {
+		return false
+	}
+	ts, er := time.Parse(time.RFC3339, exp)
+	if er != nil {
+		return false
+	}
+	return !now.Before(ts)
+}
+
+func (m *manager) reapExpired(t pb.ItemType) {
+	items, er := m.reg.List(registry.WithType(t))
+	if er != nil {
+		return
+	}
+	now := time.Now()
+	for _, it := range items {
+		if !leaseExpired(it.Metadata(), now) {
+			continue
+		}
+		fmt.Println("Lease expired, deregistering orphaned item", it.ID())
+		_ = m.reg.Deregister(it, registry.WithDeregisterFull())
+
+		var svc service.Service
+		var srv server.Server
+		switch {
+		case it.As(&svc):
+			m.events.dispatch(LifecycleEvent{Kind: LeaseLost, Service: svc, At: time.Now()})
+		case it.As(&srv):
+			m.events.dispatch(LifecycleEvent{Kind: LeaseLost, Server: srv, At: time.Now()})
+		default:
+			// Orphaned node: no service.Service/server.Server representation to carry on the event.
+			m.publishKeepAliveFailed(it.ID())
+		}
+	}
+}
+
+func (m *manager) publishKeepAliveFailed(itemID string) {
+	m.brokerMu.Lock()
+	br := m.broker
+	m.brokerMu.Unlock()
+	if br == nil {
+		return
+	}
+	_ = br.Publish(context.Background(), common.TopicRegistryCommand, broker.NewMessage(map[string]string{
+		"command":  CommandKeepAliveFailed,
+		"itemName": itemID,
+	}))
+}
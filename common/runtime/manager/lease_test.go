@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) 2019-2022. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package manager
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLeaseExpiredNoMetadata(t *testing.T) {
+	if leaseExpired(nil, time.Now()) {
+		t.Fatal("an item with no lease metadata should never be considered expired")
+	}
+	if leaseExpired(map[string]string{"other": "x"}, time.Now()) {
+		t.Fatal("an item without MetaLeaseExpiry should never be considered expired")
+	}
+}
+
+func TestLeaseExpiredMalformedTimestamp(t *testing.T) {
+	meta := map[string]string{MetaLeaseExpiry: "not-a-timestamp"}
+	if leaseExpired(meta, time.Now()) {
+		t.Fatal("a malformed expiry should not be treated as expired")
+	}
+}
+
+func TestLeaseExpiredInThePast(t *testing.T) {
+	meta := map[string]string{MetaLeaseExpiry: time.Now().Add(-time.Minute).Format(time.RFC3339)}
+	if !leaseExpired(meta, time.Now()) {
+		t.Fatal("expected an expiry in the past to be expired")
+	}
+}
+
+func TestLeaseExpiredInTheFuture(t *testing.T) {
+	meta := map[string]string{MetaLeaseExpiry: time.Now().Add(time.Hour).Format(time.RFC3339)}
+	if leaseExpired(meta, time.Now()) {
+		t.Fatal("expected an expiry in the future to not be expired")
+	}
+}
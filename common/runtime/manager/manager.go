@@ -23,8 +23,10 @@ package manager
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/bep/debounce"
@@ -45,9 +47,10 @@ import (
 )
 
 const (
-	CommandStart   = "start"
-	CommandStop    = "stop"
-	CommandRestart = "restart"
+	CommandStart           = "start"
+	CommandStop            = "stop"
+	CommandRestart         = "restart"
+	CommandKeepAliveFailed = "keepAliveFailed"
 )
 
 type Manager interface {
@@ -57,6 +60,13 @@ type Manager interface {
 	SetServeOptions(...server.ServeOption)
 	WatchServicesConfigs()
 	WatchBroker(ctx context.Context, br broker.Broker) error
+	MetricsHandler() http.Handler
+	RegisterApplication(appID string, svcs []service.Service) error
+	SubscribeApplications() <-chan *Application
+	RestartServer(srv server.Server, opts RestartOptions) error
+	Route(serviceName, key string) (registry.Item, error)
+	AddListener(kind EventKind, fn func(LifecycleEvent), oo ...ListenerOption) int
+	RemoveListener(kind EventKind, id int)
 }
 
 type manager struct {
@@ -70,15 +80,101 @@ type manager struct {
 
 	servers  map[string]server.Server
 	services map[string]service.Service
+
+	metrics Reporter
+
+	metadataReport MetadataReport
+	appsMu         sync.Mutex
+	applications   map[string]*Application
+	serviceApps    map[string]string
+	appWatchers    []chan *Application
+
+	leaseTTL    time.Duration
+	leaseReaper bool
+	leasesMu    sync.Mutex
+	leases      map[string]*lease
+
+	brokerMu sync.Mutex
+	broker   broker.Broker
+
+	drainMu     sync.Mutex
+	drainGroups map[string]*sync.WaitGroup
+
+	selectorsMu sync.Mutex
+	selectors   map[string]Selector
+
+	replicaMu           sync.Mutex
+	replicaReservations map[string]*replicaReservation
+
+	startTimesMu sync.Mutex
+	startTimes   map[string]time.Time
+
+	events *eventBus
+}
+
+// Option customizes a manager at construction time.
+type Option func(*manager)
+
+// WithMetricsReporter overrides the default Prometheus Reporter, e.g. to let
+// a third-party server contribute its own labels or ship to a different
+// backend.
+func WithMetricsReporter(r Reporter) Option {
+	return func(m *manager) {
+		m.metrics = r
+	}
 }
 
-func NewManager(reg registry.Registry, srcUrl string, namespace string) Manager {
+func NewManager(reg registry.Registry, srcUrl string, namespace string, oo ...Option) Manager {
 	m := &manager{
 		ns:       namespace,
 		srcUrl:   srcUrl,
 		reg:      reg,
 		servers:  make(map[string]server.Server),
 		services: make(map[string]service.Service),
+		metrics:  NewPromReporter(namespace),
+
+		metadataReport: newMemMetadataReport(),
+		applications:   make(map[string]*Application),
+		serviceApps:    make(map[string]string),
+
+		leaseTTL: DefaultLeaseTTL,
+		leases:   make(map[string]*lease),
+
+		drainGroups: make(map[string]*sync.WaitGroup),
+		selectors:   make(map[string]Selector),
+
+		replicaReservations: make(map[string]*replicaReservation),
+
+		startTimes: make(map[string]time.Time),
+
+		events: newEventBus(),
+	}
+	// Default listeners: keep the previous behaviors (config-triggered
+	// restarts, broker notification on lease loss) working out of the box,
+	// as plain subscribers that anyone else can sit alongside.
+	m.AddListener(RestartRequested, func(ev LifecycleEvent) {
+		if ev.Service != nil {
+			if er := m.stopService(ev.Service); er == nil {
+				_ = m.startService(ev.Service)
+			}
+		} else if ev.Server != nil {
+			_ = m.RestartServer(ev.Server, DefaultRestartOptions())
+		}
+	})
+	m.AddListener(LeaseLost, func(ev LifecycleEvent) {
+		id := ""
+		switch {
+		case ev.Service != nil:
+			id = ev.Service.ID()
+		case ev.Server != nil:
+			id = ev.Server.ID()
+		}
+		if id != "" {
+			m.publishKeepAliveFailed(id)
+		}
+	})
+	for _, o := range oo {
+		o(m)
 	}
 	// Detect a parent root
 	var current, parent registry.Item
@@ -124,6 +220,7 @@ func (m *manager) Init(ctx context.Context) error {
 	}
 
 	byScheme := map[string]server.Server{}
+	byApp := map[string][]service.Service{}
 
 	for _, ss := range services {
 		var s service.Service
@@ -163,16 +260,37 @@ func (m *manager) Init(ctx context.Context) error {
 		}
 
 		m.services[s.ID()] = s
+		m.acquireItemLease(ctx, s, m.leaseTTL)
+
+		if appID := ss.Metadata()[MetaAppID]; appID != "" {
+			byApp[appID] = append(byApp[appID], s)
+		}
+
+	}
 
+	for appID, svcs := range byApp {
+		if er := m.RegisterApplication(appID, svcs); er != nil {
+			return er
+		}
 	}
 
 	if m.root != nil {
 		for _, sr := range byScheme {
 			m.servers[sr.ID()] = sr // Keep a ref to the actual object
-			_, _ = m.reg.RegisterEdge(m.root.ID(), sr.ID(), "Node", map[string]string{})
+			if er := m.reg.Register(sr, registry.WithEdgeTo(m.root.ID(), "Node", map[string]string{})); er != nil {
+				return er
+			}
+			m.acquireItemLease(ctx, sr, m.leaseTTL)
 		}
+		m.acquireItemLease(ctx, m.root, m.leaseTTL)
+	}
+
+	if m.leaseReaper {
+		go m.runLeaseReaper(ctx)
 	}
 
+	go m.runUptimeReporter(ctx)
+
 	return nil
 
 }
@@ -181,6 +299,12 @@ func (m *manager) SetServeOptions(oo ...server.ServeOption) {
 	m.serveOptions = oo
 }
 
+// MetricsHandler exposes the manager's Reporter scrape endpoint, so that a
+// node's own servers can mount it, e.g. at /metrics.
+func (m *manager) MetricsHandler() http.Handler {
+	return m.metrics.Handler()
+}
+
 func (m *manager) ServeAll(oo ...server.ServeOption) {
 	m.serveOptions = oo
 	opt := &server.ServeOptions{}
@@ -204,6 +328,7 @@ func (m *manager) ServeAll(oo ...server.ServeOption) {
 }
 
 func (m *manager) StopAll() {
+	m.revokeAllLeases()
 	eg := &errgroup.Group{}
 	for _, srv := range m.serversWithStatus(registry.StatusReady) {
 		func(sr server.Server) {
@@ -220,21 +345,42 @@ func (m *manager) StopAll() {
 
 func (m *manager) startServer(srv server.Server, oo ...server.ServeOption) error {
 	opts := append(oo)
+	var reserved []service.Service
 	for _, svc := range m.services {
 		if svc.Options().Server == srv {
-			if svc.Options().Unique && m.regRunningService(svc.Name()) {
-				// There is already a running service here. Do not start now, watch registry and postpone start
-				fmt.Printf("There is already a running instance of %s. Do not start now, watch registry and postpone start\n", svc.Name())
+			if !m.tryReserveReplica(svc) {
+				// Already at full replica count. Do not start now, watch registry and postpone start
+				m.metrics.UniqueServicePostponed(svc)
+				m.events.dispatch(LifecycleEvent{Kind: UniquePostponed, Service: svc, At: time.Now()})
 				go m.WatchUniqueNeedsStart(svc)
 				continue
 			}
+			reserved = append(reserved, svc)
 			opts = append(opts, m.serviceServeOptions(svc)...)
 		}
 	}
-	return srv.Serve(opts...)
+	start := time.Now()
+	m.events.dispatch(LifecycleEvent{Kind: BeforeStart, Server: srv, At: start})
+	er := srv.Serve(opts...)
+	for _, svc := range reserved {
+		// The registry now reflects the real status set by svc.Start/OnServe,
+		// win or lose, so the reservation has served its purpose.
+		m.releaseReplicaReservation(svc)
+	}
+	if er != nil {
+		m.metrics.ServerStartFailed(srv, er)
+		m.events.dispatch(LifecycleEvent{Kind: AfterStart, Server: srv, Err: er, At: time.Now()})
+		return er
+	}
+	m.metrics.ServerStarted(srv, time.Since(start))
+	m.metrics.SetServicesPerServer(srv, len(m.servicesRunningOn(srv)))
+	m.recordStart(srv.ID(), start)
+	m.events.dispatch(LifecycleEvent{Kind: AfterStart, Server: srv, At: time.Now()})
+	return nil
 }
 
 func (m *manager) stopServer(srv server.Server, oo ...registry.RegisterOption) error {
+	m.events.dispatch(LifecycleEvent{Kind: BeforeStop, Server: srv, At: time.Now()})
 	// Stop all running services on this server
 	eg := &errgroup.Group{}
 	for _, svc := range m.servicesRunningOn(srv) {
@@ -245,56 +391,122 @@ func (m *manager) stopServer(srv server.Server, oo ...registry.RegisterOption) e
 		}(svc)
 	}
 	if er := eg.Wait(); er != nil {
+		m.events.dispatch(LifecycleEvent{Kind: AfterStop, Server: srv, Err: er, At: time.Now()})
 		return er
 	}
 	// Stop server now
-	return srv.Stop(oo...)
+	if er := srv.Stop(oo...); er != nil {
+		m.events.dispatch(LifecycleEvent{Kind: AfterStop, Server: srv, Err: er, At: time.Now()})
+		return er
+	}
+	m.metrics.ServerStopped(srv)
+	m.clearStart(srv.ID())
+	m.events.dispatch(LifecycleEvent{Kind: AfterStop, Server: srv, At: time.Now()})
+	return nil
 }
 
 func (m *manager) startService(svc service.Service) error {
 	// Look up for corresponding server
 	srv := svc.Options().Server
 	serveOptions := append(m.serveOptions, m.serviceServeOptions(svc)...)
+	start := time.Now()
+
+	m.events.dispatch(LifecycleEvent{Kind: BeforeStart, Service: svc, At: start})
 
 	if srv.Is(registry.StatusStopped) {
 
-		fmt.Println("Server is not running, starting " + srv.ID() + " now")
-		return srv.Serve(serveOptions...)
+		if er := srv.Serve(serveOptions...); er != nil {
+			m.metrics.ServiceStartFailed(svc, er)
+			m.events.dispatch(LifecycleEvent{Kind: AfterStart, Service: svc, Err: er, At: time.Now()})
+			return er
+		}
 
 	} else if srv.NeedsRestart() {
 
-		fmt.Println("Server needs a restart to append a new service")
 		for _, sv := range m.servicesRunningOn(srv) {
 			serveOptions = append(serveOptions, m.serviceServeOptions(sv)...)
 		}
 		if er := m.stopServer(srv); er != nil {
 			return er
 		}
-		return srv.Serve(serveOptions...)
+		if er := srv.Serve(serveOptions...); er != nil {
+			m.metrics.ServiceStartFailed(svc, er)
+			m.events.dispatch(LifecycleEvent{Kind: AfterStart, Service: svc, Err: er, At: time.Now()})
+			return er
+		}
 
 	} else {
 
-		fmt.Println("Starting service")
 		if er := svc.Start(); er != nil {
+			m.metrics.ServiceStartFailed(svc, er)
+			m.events.dispatch(LifecycleEvent{Kind: AfterStart, Service: svc, Err: er, At: time.Now()})
 			return er
 		}
 		if er := svc.OnServe(); er != nil {
+			m.metrics.ServiceStartFailed(svc, er)
+			m.events.dispatch(LifecycleEvent{Kind: AfterStart, Service: svc, Err: er, At: time.Now()})
 			return er
 		}
 
 	}
 
+	m.metrics.ServiceStarted(svc, time.Since(start))
+	m.metrics.SetServiceStatus(svc, registry.StatusReady)
+	m.recordStart(svc.ID(), start)
+	m.events.dispatch(LifecycleEvent{Kind: AfterStart, Service: svc, At: time.Now()})
 	return nil
 }
 
 func (m *manager) stopService(svc service.Service, oo ...registry.RegisterOption) error {
-	return svc.Stop(oo...)
+	m.events.dispatch(LifecycleEvent{Kind: BeforeStop, Service: svc, At: time.Now()})
+	if er := svc.Stop(oo...); er != nil {
+		m.events.dispatch(LifecycleEvent{Kind: AfterStop, Service: svc, Err: er, At: time.Now()})
+		return er
+	}
+	m.metrics.ServiceStopped(svc)
+	m.metrics.SetServiceStatus(svc, registry.StatusStopped)
+	m.clearStart(svc.ID())
+	if len(oo) > 0 {
+		// A RegisterOption (e.g. WithDeregisterFull) means svc is leaving for
+		// good, not just restarting, so its Application bookkeeping can go too.
+		m.forgetApplicationMember(svc)
+	}
+	m.events.dispatch(LifecycleEvent{Kind: AfterStop, Service: svc, At: time.Now()})
+	return nil
 }
 
 func (m *manager) serviceServeOptions(svc service.Service) []server.ServeOption {
 	return []server.ServeOption{
-		server.WithBeforeServe(svc.Start),
-		server.WithAfterServe(svc.OnServe),
+		server.WithBeforeServe(m.trackDrainStart(svc)),
+		server.WithAfterServe(m.trackDrainEnd(svc)),
+	}
+}
+
+// trackDrainStart wraps svc.Start so its server's drain WaitGroup (see
+// awaitDrain) counts it as in-flight for the duration of its startup
+// sequence - the only window these interceptors can observe - so a
+// concurrent RestartServer does not start tearing the server down while one
+// of its services is still coming up. If Start fails, AfterServe is never
+// called for it, so the count is released here rather than left for
+// trackDrainEnd.
+func (m *manager) trackDrainStart(svc service.Service) func() error {
+	return func() error {
+		wg := m.drainWaitGroup(svc.Server())
+		wg.Add(1)
+		if er := svc.Start(); er != nil {
+			wg.Done()
+			return er
+		}
+		return nil
+	}
+}
+
+// trackDrainEnd wraps svc.OnServe to release the count trackDrainStart added
+// once the service has settled into serving.
+func (m *manager) trackDrainEnd(svc service.Service) func() error {
+	return func() error {
+		defer m.drainWaitGroup(svc.Server()).Done()
+		return svc.OnServe()
 	}
 }
 
@@ -328,14 +540,16 @@ func (m *manager) WatchServicesConfigs() {
 		}
 		var svc service.Service
 		if ss[0].As(&svc) && svc.Options().AutoRestart {
-			if er := m.stopService(svc); er == nil {
-				_ = m.startService(svc)
-			}
+			m.events.dispatch(LifecycleEvent{Kind: RestartRequested, Service: svc, At: time.Now()})
 		}
 	}
 }
 
 func (m *manager) WatchBroker(ctx context.Context, br broker.Broker) error {
+	m.brokerMu.Lock()
+	m.broker = br
+	m.brokerMu.Unlock()
+
 	_, er := br.Subscribe(ctx, common.TopicRegistryCommand, func(message broker.Message) error {
 		hh, _ := message.RawData()
 		cmd := hh["command"]
@@ -374,14 +588,14 @@ func (m *manager) WatchBroker(ctx context.Context, br broker.Broker) error {
 			case CommandStop:
 				return m.stopService(svc)
 			case CommandRestart:
-				if er := m.stopService(svc); er != nil {
-					return er
-				}
-				return m.startService(svc)
+				// The default RestartRequested listener registered in NewManager
+				// performs the actual stop/start; dispatching here is enough.
+				m.events.dispatch(LifecycleEvent{Kind: RestartRequested, Service: svc, At: time.Now()})
+				return nil
 			default:
 				return fmt.Errorf("unsupported command %s", cmd)
 			}
-		} else if srv == nil {
+		} else if srv != nil {
 			// Server Commands
 			switch cmd {
 			case CommandStart:
@@ -389,10 +603,10 @@ func (m *manager) WatchBroker(ctx context.Context, br broker.Broker) error {
 			case CommandStop:
 				return m.stopServer(srv)
 			case CommandRestart:
-				if er := m.stopServer(srv); er != nil {
-					return er
-				}
-				return m.startServer(srv, m.serveOptions...)
+				// The default RestartRequested listener registered in NewManager
+				// performs the actual rolling restart; dispatching here is enough.
+				m.events.dispatch(LifecycleEvent{Kind: RestartRequested, Server: srv, At: time.Now()})
+				return nil
 			default:
 				return fmt.Errorf("unsupported command %s", cmd)
 			}
@@ -406,15 +620,197 @@ func (m *manager) WatchBroker(ctx context.Context, br broker.Broker) error {
 }
 
 func (m *manager) regRunningService(name string) bool {
+	return m.regRunningServiceCount(name) > 0
+}
+
+func (m *manager) regRunningServiceCount(name string) int {
 	ll, _ := m.reg.List(registry.WithType(pb.ItemType_SERVICE), registry.WithName(name))
+	count := 0
 	for _, l := range ll {
 		if l.Metadata()[registry.MetaStatusKey] != string(registry.StatusStopped) {
-			return true
+			count++
 		}
 	}
-	return false
+	return count
 }
 
+// Route picks one ready instance of serviceName for client-side routing,
+// using the Selector strategy declared on the service (defaulting to
+// random), consulting key for strategies that need it (consistent-hash).
+func (m *manager) Route(serviceName, key string) (registry.Item, error) {
+	ll, er := m.reg.List(registry.WithType(pb.ItemType_SERVICE), registry.WithName(serviceName))
+	if er != nil {
+		return nil, er
+	}
+	var candidates []registry.Item
+	for _, l := range ll {
+		if l.Metadata()[registry.MetaStatusKey] == string(registry.StatusReady) {
+			candidates = append(candidates, l)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no ready instance of service %s", serviceName)
+	}
+
+	sel := m.selectorFor(serviceName)
+	if ks, ok := sel.(KeyedSelector); ok && key != "" {
+		return ks.PickForKey(candidates, key)
+	}
+	return sel.Pick(candidates)
+}
+
+func (m *manager) selectorFor(serviceName string) Selector {
+	m.selectorsMu.Lock()
+	defer m.selectorsMu.Unlock()
+	if sel, ok := m.selectors[serviceName]; ok {
+		return sel
+	}
+	strategy := ""
+	for _, svc := range m.services {
+		if svc.Name() == serviceName {
+			strategy = svc.Options().SelectorStrategy
+			break
+		}
+	}
+	sel := NewSelector(strategy)
+	m.selectors[serviceName] = sel
+	return sel
+}
+
+// desiredReplicas returns how many concurrent instances of svc should be
+// running cluster-wide: Replicas if set, 1 for a Unique service, or 0 when
+// the service may run unbounded.
+func (m *manager) desiredReplicas(svc service.Service) int {
+	opts := svc.Options()
+	if opts.Replicas > 0 {
+		return opts.Replicas
+	}
+	if opts.Unique {
+		return 1
+	}
+	return 0
+}
+
+// recordStart remembers when id (a service or server) started, for
+// runUptimeReporter to report against.
+func (m *manager) recordStart(id string, at time.Time) {
+	m.startTimesMu.Lock()
+	m.startTimes[id] = at
+	m.startTimesMu.Unlock()
+}
+
+// clearStart forgets id's start time once it has stopped, so its uptime
+// gauge stops being reported.
+func (m *manager) clearStart(id string) {
+	m.startTimesMu.Lock()
+	delete(m.startTimes, id)
+	m.startTimesMu.Unlock()
+}
+
+// runUptimeReporter periodically refreshes the uptime gauge for every
+// currently running service and server.
+func (m *manager) runUptimeReporter(ctx context.Context) {
+	t := time.NewTicker(15 * time.Second)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			m.startTimesMu.Lock()
+			times := make(map[string]time.Time, len(m.startTimes))
+			for id, at := range m.startTimes {
+				times[id] = at
+			}
+			m.startTimesMu.Unlock()
+			for id, at := range times {
+				m.metrics.SetUptime(id, at)
+			}
+		}
+	}
+}
+
+// reservationStatus is the MetaStatusKey value a replicaReservation is
+// registered with: deliberately neither StatusStopped (regRunningServiceCount
+// would then ignore it) nor StatusReady (Route would start sending it
+// traffic).
+const reservationStatus = "reserving"
+
+// replicaReservation is a throwaway service.Service registered as a
+// placeholder SERVICE item for the duration of a single start attempt, so
+// that regRunningServiceCount sees a claimed slot the same way on every
+// manager in the cluster, not just this process. It is leased like any other
+// item (see lease.go), so a manager crashing mid-reservation does not leave
+// the slot claimed forever - the reaper reclaims it once the lease expires.
+type replicaReservation struct {
+	id, name string
+}
+
+func (r *replicaReservation) ID() string   { return r.id }
+func (r *replicaReservation) Name() string { return r.name }
+func (r *replicaReservation) Metadata() map[string]string {
+	return map[string]string{registry.MetaStatusKey: reservationStatus}
+}
+func (r *replicaReservation) As(interface{}) bool                  { return false }
+func (r *replicaReservation) Options() service.Options              { return service.Options{} }
+func (r *replicaReservation) Start() error                          { return nil }
+func (r *replicaReservation) Stop(...registry.RegisterOption) error { return nil }
+func (r *replicaReservation) OnServe() error                        { return nil }
+func (r *replicaReservation) Is(registry.Status) bool                { return false }
+func (r *replicaReservation) Server() server.Server                  { return nil }
+
+// tryReserveReplica claims one of svc's desired replica slots. The check
+// against desiredReplicas and the claim itself are only atomic with respect
+// to this process (replicaMu), but the claim itself is a registry item with
+// the same name as svc, so regRunningServiceCount - which every manager in
+// the cluster calls over the shared registry, not local memory - sees it
+// too. The reservation is held until releaseReplicaReservation is called,
+// once the real registry count can be trusted to reflect the attempt.
+func (m *manager) tryReserveReplica(svc service.Service) bool {
+	desired := m.desiredReplicas(svc)
+	if desired <= 0 {
+		return true
+	}
+	m.replicaMu.Lock()
+	defer m.replicaMu.Unlock()
+
+	if m.regRunningServiceCount(svc.Name()) >= desired {
+		return false
+	}
+
+	res := &replicaReservation{id: svc.ID() + "#reservation", name: svc.Name()}
+	if er := m.reg.Register(res); er != nil {
+		return false
+	}
+	m.acquireItemLease(context.Background(), res, m.leaseTTL)
+	m.replicaReservations[svc.ID()] = res
+	return true
+}
+
+// releaseReplicaReservation gives back a slot claimed by tryReserveReplica,
+// whether the start it guarded succeeded or failed, by revoking its lease
+// and deregistering the placeholder item.
+func (m *manager) releaseReplicaReservation(svc service.Service) {
+	m.replicaMu.Lock()
+	res, ok := m.replicaReservations[svc.ID()]
+	if ok {
+		delete(m.replicaReservations, svc.ID())
+	}
+	m.replicaMu.Unlock()
+	if !ok {
+		return
+	}
+
+	m.revokeLease(res.ID())
+	_ = m.reg.Deregister(res, registry.WithDeregisterFull())
+}
+
+// WatchUniqueNeedsStart watches the registry for changes to svc's named
+// group and debounces them, trying to promote svc into the freed slot each
+// time. Transitions are reported through the event bus rather than logged
+// directly: a Promoted event marks the attempt, and startService's own
+// BeforeStart/AfterStart events (the latter carrying Err on failure) cover
+// the rest, so subscribers see the whole thing instead of console output.
 func (m *manager) WatchUniqueNeedsStart(svc service.Service) {
 	db := debounce.New(5 * time.Second)
 	w, _ := m.reg.Watch(registry.WithType(pb.ItemType_SERVICE), registry.WithName(svc.Name()), registry.WithAction(pb.ActionType_ANY))
@@ -423,16 +819,15 @@ func (m *manager) WatchUniqueNeedsStart(svc service.Service) {
 		if er != nil {
 			break
 		}
-		fmt.Println("Event received for service", svc.Name())
 		db(func() {
-			if !m.regRunningService(svc.Name()) {
-				fmt.Println("Starting unique service", svc.Name())
-				if er := m.startService(svc); er != nil {
-					fmt.Println("Error while starting unique service", svc.Name(), er.Error())
-				} else {
-					w.Stop()
-				}
+			if !m.tryReserveReplica(svc) {
+				return
+			}
+			m.events.dispatch(LifecycleEvent{Kind: Promoted, Service: svc, At: time.Now()})
+			if er := m.startService(svc); er == nil {
+				w.Stop()
 			}
+			m.releaseReplicaReservation(svc)
 		})
 	}
 }
\ No newline at end of file
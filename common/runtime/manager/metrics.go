@@ -0,0 +1,214 @@
+/*
+ * Copyright (c) 2019-2022. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package manager
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/pydio/cells/v4/common/registry"
+	"github.com/pydio/cells/v4/common/server"
+	"github.com/pydio/cells/v4/common/service"
+)
+
+// Reporter receives lifecycle events from the manager and turns them into
+// observability signals. It is the extension point used by third-party
+// servers and services to contribute their own metrics without the manager
+// knowing about the underlying backend.
+type Reporter interface {
+	ServerStarted(srv server.Server, d time.Duration)
+	ServerStartFailed(srv server.Server, err error)
+	ServerStopped(srv server.Server)
+
+	ServiceStarted(svc service.Service, d time.Duration)
+	ServiceStartFailed(svc service.Service, err error)
+	ServiceStopped(svc service.Service)
+	UniqueServicePostponed(svc service.Service)
+
+	SetServicesPerServer(srv server.Server, count int)
+	SetServiceStatus(svc service.Service, status registry.Status)
+	SetUptime(id string, since time.Time)
+
+	// Handler serves the reporter's scrape endpoint, e.g. for mounting on /metrics.
+	Handler() http.Handler
+}
+
+// promReporter is the default Reporter implementation, backed by the
+// Prometheus client library.
+type promReporter struct {
+	namespace string
+
+	registry *prometheus.Registry
+
+	startsTotal    *prometheus.CounterVec
+	stopsTotal     *prometheus.CounterVec
+	failuresTotal  *prometheus.CounterVec
+	postponedTotal *prometheus.CounterVec
+
+	servicesPerServer *prometheus.GaugeVec
+	serviceStatus     *prometheus.GaugeVec
+	uptimeSeconds     *prometheus.GaugeVec
+
+	serverStartLatency  *prometheus.HistogramVec
+	serviceStartLatency *prometheus.HistogramVec
+	restartInterval     *prometheus.HistogramVec
+
+	mu            sync.Mutex
+	lastStopTimes map[string]time.Time
+	lastStatus    map[string]string
+}
+
+// metricNamespace returns the Prometheus namespace metrics are registered
+// under: plain "cells" when ns is empty, or "cells_<ns>" otherwise, so that
+// several namespaced managers sharing a process do not collide on /metrics.
+func metricNamespace(ns string) string {
+	if ns == "" {
+		return "cells"
+	}
+	return "cells_" + ns
+}
+
+// NewPromReporter creates the default Prometheus-backed Reporter, namespacing
+// all metrics under "cells_<ns>" (plain "cells" when ns is empty).
+func NewPromReporter(ns string) Reporter {
+	reg := prometheus.NewRegistry()
+	f := promauto.With(reg)
+	namespace := metricNamespace(ns)
+	r := &promReporter{
+		namespace: namespace,
+		registry:  reg,
+		startsTotal: f.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "manager", Name: "starts_total",
+			Help: "Total number of successful starts, by kind (server|service) and name.",
+		}, []string{"kind", "name"}),
+		stopsTotal: f.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "manager", Name: "stops_total",
+			Help: "Total number of stops, by kind (server|service) and name.",
+		}, []string{"kind", "name"}),
+		failuresTotal: f.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "manager", Name: "failures_total",
+			Help: "Total number of start failures, by kind (server|service) and name.",
+		}, []string{"kind", "name"}),
+		postponedTotal: f.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "manager", Name: "unique_postponed_total",
+			Help: "Total number of times a unique service start was postponed because another instance was running.",
+		}, []string{"name"}),
+		servicesPerServer: f.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace, Subsystem: "manager", Name: "services_per_server",
+			Help: "Number of services currently bound to a given server.",
+		}, []string{"server"}),
+		serviceStatus: f.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace, Subsystem: "manager", Name: "service_status",
+			Help: "Current status of a service (1 for the active status, 0 otherwise), by status.",
+		}, []string{"name", "status"}),
+		uptimeSeconds: f.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace, Subsystem: "manager", Name: "uptime_seconds",
+			Help: "Uptime in seconds of a server or service since it was last started.",
+		}, []string{"id"}),
+		serverStartLatency: f.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Subsystem: "manager", Name: "server_start_latency_seconds",
+			Help: "Time taken for a server to start.",
+		}, []string{"server"}),
+		serviceStartLatency: f.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Subsystem: "manager", Name: "service_start_latency_seconds",
+			Help: "Time taken for a service to start.",
+		}, []string{"name"}),
+		restartInterval: f.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Subsystem: "manager", Name: "restart_interval_seconds",
+			Help: "Time elapsed between a service being stopped and started again.",
+		}, []string{"name"}),
+		lastStopTimes: make(map[string]time.Time),
+		lastStatus:    make(map[string]string),
+	}
+	return r
+}
+
+func (r *promReporter) ServerStarted(srv server.Server, d time.Duration) {
+	r.startsTotal.WithLabelValues("server", srv.ID()).Inc()
+	r.serverStartLatency.WithLabelValues(srv.ID()).Observe(d.Seconds())
+}
+
+func (r *promReporter) ServerStartFailed(srv server.Server, err error) {
+	r.failuresTotal.WithLabelValues("server", srv.ID()).Inc()
+}
+
+func (r *promReporter) ServerStopped(srv server.Server) {
+	r.stopsTotal.WithLabelValues("server", srv.ID()).Inc()
+}
+
+func (r *promReporter) ServiceStarted(svc service.Service, d time.Duration) {
+	r.startsTotal.WithLabelValues("service", svc.Name()).Inc()
+	r.serviceStartLatency.WithLabelValues(svc.Name()).Observe(d.Seconds())
+
+	r.mu.Lock()
+	if last, ok := r.lastStopTimes[svc.Name()]; ok {
+		r.restartInterval.WithLabelValues(svc.Name()).Observe(time.Since(last).Seconds())
+		delete(r.lastStopTimes, svc.Name())
+	}
+	r.mu.Unlock()
+}
+
+func (r *promReporter) ServiceStartFailed(svc service.Service, err error) {
+	r.failuresTotal.WithLabelValues("service", svc.Name()).Inc()
+}
+
+func (r *promReporter) ServiceStopped(svc service.Service) {
+	r.stopsTotal.WithLabelValues("service", svc.Name()).Inc()
+	r.mu.Lock()
+	r.lastStopTimes[svc.Name()] = time.Now()
+	r.mu.Unlock()
+}
+
+func (r *promReporter) UniqueServicePostponed(svc service.Service) {
+	r.postponedTotal.WithLabelValues(svc.Name()).Inc()
+}
+
+func (r *promReporter) SetServicesPerServer(srv server.Server, count int) {
+	r.servicesPerServer.WithLabelValues(srv.ID()).Set(float64(count))
+}
+
+func (r *promReporter) SetServiceStatus(svc service.Service, status registry.Status) {
+	name := svc.Name()
+	next := string(status)
+
+	r.mu.Lock()
+	prev, hadPrev := r.lastStatus[name]
+	r.lastStatus[name] = next
+	r.mu.Unlock()
+
+	if hadPrev && prev != next {
+		r.serviceStatus.WithLabelValues(name, prev).Set(0)
+	}
+	r.serviceStatus.WithLabelValues(name, next).Set(1)
+}
+
+func (r *promReporter) SetUptime(id string, since time.Time) {
+	r.uptimeSeconds.WithLabelValues(id).Set(time.Since(since).Seconds())
+}
+
+func (r *promReporter) Handler() http.Handler {
+	return promhttp.HandlerFor(r.registry, promhttp.HandlerOpts{})
+}
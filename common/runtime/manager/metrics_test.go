@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2019-2022. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/pydio/cells/v4/common/registry"
+	"github.com/pydio/cells/v4/common/server"
+	"github.com/pydio/cells/v4/common/service"
+)
+
+// fakeMetricsService is a minimal service.Service, enough to exercise the
+// Reporter, which only keys metrics off Name().
+type fakeMetricsService struct {
+	name string
+}
+
+func (f fakeMetricsService) ID() string                  { return f.name }
+func (f fakeMetricsService) Name() string                 { return f.name }
+func (f fakeMetricsService) Metadata() map[string]string  { return nil }
+func (f fakeMetricsService) As(interface{}) bool           { return false }
+func (f fakeMetricsService) Options() service.Options       { return service.Options{} }
+func (f fakeMetricsService) Start() error                  { return nil }
+func (f fakeMetricsService) Stop(...registry.RegisterOption) error { return nil }
+func (f fakeMetricsService) OnServe() error                { return nil }
+func (f fakeMetricsService) Is(registry.Status) bool        { return false }
+func (f fakeMetricsService) Server() server.Server          { return nil }
+
+func gaugeValue(t *testing.T, g *prometheus.GaugeVec, labels ...string) float64 {
+	t.Helper()
+	m := &dto.Metric{}
+	if er := g.WithLabelValues(labels...).Write(m); er != nil {
+		t.Fatalf("reading gauge value: %v", er)
+	}
+	return m.GetGauge().GetValue()
+}
+
+func TestSetServiceStatusResetsPreviousLabel(t *testing.T) {
+	r := NewPromReporter("test").(*promReporter)
+	svc := fakeMetricsService{name: "svc-a"}
+
+	r.SetServiceStatus(svc, registry.StatusReady)
+	if v := gaugeValue(t, r.serviceStatus, "svc-a", string(registry.StatusReady)); v != 1 {
+		t.Fatalf("expected ready=1 after first transition, got %v", v)
+	}
+
+	r.SetServiceStatus(svc, registry.StatusStopped)
+	if v := gaugeValue(t, r.serviceStatus, "svc-a", string(registry.StatusStopped)); v != 1 {
+		t.Fatalf("expected stopped=1 after second transition, got %v", v)
+	}
+	if v := gaugeValue(t, r.serviceStatus, "svc-a", string(registry.StatusReady)); v != 0 {
+		t.Fatalf("expected the previous ready label to be reset to 0, got %v", v)
+	}
+}
+
+func TestSetUptimeReportsElapsedTime(t *testing.T) {
+	r := NewPromReporter("test").(*promReporter)
+	since := time.Now().Add(-5 * time.Second)
+
+	r.SetUptime("server-1", since)
+
+	v := gaugeValue(t, r.uptimeSeconds, "server-1")
+	if v < 4.5 || v > 10 {
+		t.Fatalf("expected uptime close to 5s, got %v", v)
+	}
+}
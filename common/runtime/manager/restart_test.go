@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2019-2022. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package manager
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pydio/cells/v4/common/registry"
+	"github.com/pydio/cells/v4/common/server"
+	"github.com/pydio/cells/v4/common/service"
+)
+
+// fakeRestartServer is a minimal server.Server used only to exercise the
+// drain-tracking helpers (drainWaitGroup, awaitDrain), which only need ID().
+type fakeRestartServer struct {
+	id string
+}
+
+func (f *fakeRestartServer) ID() string                   { return f.id }
+func (f *fakeRestartServer) Name() string                 { return f.id }
+func (f *fakeRestartServer) Metadata() map[string]string  { return nil }
+func (f *fakeRestartServer) As(interface{}) bool          { return false }
+func (f *fakeRestartServer) Is(registry.Status) bool       { return false }
+func (f *fakeRestartServer) NeedsRestart() bool            { return false }
+func (f *fakeRestartServer) Serve(...server.ServeOption) error { return nil }
+func (f *fakeRestartServer) Stop(...registry.RegisterOption) error { return nil }
+
+// fakeRestartService is a minimal service.Service used only to exercise
+// trackDrainStart/trackDrainEnd, which only need Server(), Start() and
+// OnServe().
+type fakeRestartService struct {
+	server       server.Server
+	onServeDelay time.Duration
+}
+
+func (f *fakeRestartService) ID() string                  { return "svc" }
+func (f *fakeRestartService) Name() string                { return "svc" }
+func (f *fakeRestartService) Metadata() map[string]string { return nil }
+func (f *fakeRestartService) As(interface{}) bool         { return false }
+func (f *fakeRestartService) Options() service.Options     { return service.Options{} }
+func (f *fakeRestartService) Start() error                { return nil }
+func (f *fakeRestartService) Stop(...registry.RegisterOption) error { return nil }
+func (f *fakeRestartService) OnServe() error {
+	time.Sleep(f.onServeDelay)
+	return nil
+}
+func (f *fakeRestartService) Is(registry.Status) bool { return false }
+func (f *fakeRestartService) Server() server.Server   { return f.server }
+
+func TestManagerAwaitDrainWaitsForRealWork(t *testing.T) {
+	m := &manager{drainGroups: make(map[string]*sync.WaitGroup)}
+	srv := &fakeRestartServer{id: "srv1"}
+	wg := m.drainWaitGroup(srv)
+
+	wg.Add(1)
+
+	done := make(chan struct{})
+	go func() {
+		m.awaitDrain(srv, 500*time.Millisecond)
+		close(done)
+	}()
+
+	// Simulate a service startup still in flight, finishing well within the drain window.
+	time.Sleep(50 * time.Millisecond)
+	wg.Done()
+
+	select {
+	case <-done:
+	case <-time.After(400 * time.Millisecond):
+		t.Fatal("awaitDrain should have returned as soon as the tracked work finished")
+	}
+}
+
+func TestServiceServeOptionsFeedTheDrainWaitGroupAwaitDrainWatches(t *testing.T) {
+	m := &manager{drainGroups: make(map[string]*sync.WaitGroup)}
+	srv := &fakeRestartServer{id: "srv3"}
+	svc := &fakeRestartService{server: srv, onServeDelay: 100 * time.Millisecond}
+
+	beforeServe, afterServe := m.trackDrainStart(svc), m.trackDrainEnd(svc)
+	if er := beforeServe(); er != nil {
+		t.Fatalf("beforeServe: %v", er)
+	}
+	go func() { _ = afterServe() }()
+
+	start := time.Now()
+	m.awaitDrain(srv, 500*time.Millisecond)
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Fatalf("awaitDrain returned after %v, before the in-flight service startup settled", elapsed)
+	}
+}
+
+func TestManagerAwaitDrainTimesOut(t *testing.T) {
+	m := &manager{drainGroups: make(map[string]*sync.WaitGroup)}
+	srv := &fakeRestartServer{id: "srv2"}
+	wg := m.drainWaitGroup(srv)
+	wg.Add(1) // never Done: simulates work still in flight past the window
+
+	start := time.Now()
+	m.awaitDrain(srv, 50*time.Millisecond)
+	if time.Since(start) < 50*time.Millisecond {
+		t.Fatal("awaitDrain returned before its drain window elapsed")
+	}
+}
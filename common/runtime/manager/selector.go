@@ -0,0 +1,150 @@
+/*
+ * Copyright (c) 2019-2022. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package manager
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"sync"
+
+	"github.com/pydio/cells/v4/common/registry"
+)
+
+// Selector picks one item among candidates returned for a service name, so
+// that callers can route to a multi-replica service without knowing how it
+// balances load.
+type Selector interface {
+	Pick(candidates []registry.Item) (registry.Item, error)
+}
+
+// KeyedSelector is implemented by selectors that need the routing key, such
+// as a consistent-hash strategy.
+type KeyedSelector interface {
+	Selector
+	PickForKey(candidates []registry.Item, key string) (registry.Item, error)
+}
+
+// Selector strategy names, as set on service.Options.SelectorStrategy.
+const (
+	SelectorRandom           = "random"
+	SelectorRoundRobin       = "round-robin"
+	SelectorLeastConnections = "least-connections"
+	SelectorConsistentHash   = "consistent-hash"
+)
+
+// NewSelector builds the Selector for a given strategy name, defaulting to
+// random when the strategy is empty or unknown.
+func NewSelector(strategy string) Selector {
+	switch strategy {
+	case SelectorRoundRobin:
+		return &roundRobinSelector{}
+	case SelectorLeastConnections:
+		return &leastConnectionsSelector{counts: map[string]int{}}
+	case SelectorConsistentHash:
+		return &consistentHashSelector{}
+	default:
+		return randomSelector{}
+	}
+}
+
+type randomSelector struct{}
+
+func (randomSelector) Pick(candidates []registry.Item) (registry.Item, error) {
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no candidates to select from")
+	}
+	return candidates[rand.Intn(len(candidates))], nil
+}
+
+type roundRobinSelector struct {
+	mu  sync.Mutex
+	pos uint64
+}
+
+func (s *roundRobinSelector) Pick(candidates []registry.Item) (registry.Item, error) {
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no candidates to select from")
+	}
+	s.mu.Lock()
+	idx := int(s.pos % uint64(len(candidates)))
+	s.pos++
+	s.mu.Unlock()
+	return candidates[idx], nil
+}
+
+// leastConnectionsSelector approximates connection counts by the number of
+// times each candidate was picked, as the registry does not expose live
+// connection counts.
+type leastConnectionsSelector struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (s *leastConnectionsSelector) Pick(candidates []registry.Item) (registry.Item, error) {
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no candidates to select from")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	best := candidates[0]
+	for _, c := range candidates[1:] {
+		if s.counts[c.ID()] < s.counts[best.ID()] {
+			best = c
+		}
+	}
+	s.counts[best.ID()]++
+	return best, nil
+}
+
+// consistentHashSelector maps a routing key onto a ring built from the
+// candidate IDs, so the same key keeps landing on the same replica as the
+// candidate set changes size.
+type consistentHashSelector struct{}
+
+func (s *consistentHashSelector) Pick(candidates []registry.Item) (registry.Item, error) {
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no candidates to select from")
+	}
+	return candidates[0], nil
+}
+
+func (s *consistentHashSelector) PickForKey(candidates []registry.Item, key string) (registry.Item, error) {
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no candidates to select from")
+	}
+	sorted := append([]registry.Item{}, candidates...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID() < sorted[j].ID() })
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	kh := h.Sum32()
+	var pick, dist = registry.Item(nil), uint32(0)
+	for _, c := range sorted {
+		h.Reset()
+		_, _ = h.Write([]byte(c.ID()))
+		// Clockwise distance from the key to c's point on the ring, wrapping past 0.
+		if d := h.Sum32() - kh; pick == nil || d < dist {
+			pick, dist = c, d
+		}
+	}
+	return pick, nil
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2019-2022. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package manager
+
+import (
+	"testing"
+
+	"github.com/pydio/cells/v4/common/registry"
+)
+
+// fakeSelectorItem is a minimal registry.Item, enough to exercise the
+// Selector implementations, which only key off ID().
+type fakeSelectorItem struct {
+	id string
+}
+
+func (f fakeSelectorItem) ID() string                  { return f.id }
+func (f fakeSelectorItem) Name() string                 { return f.id }
+func (f fakeSelectorItem) Metadata() map[string]string  { return nil }
+func (f fakeSelectorItem) As(interface{}) bool          { return false }
+
+func items(ids ...string) []registry.Item {
+	ii := make([]registry.Item, 0, len(ids))
+	for _, id := range ids {
+		ii = append(ii, fakeSelectorItem{id: id})
+	}
+	return ii
+}
+
+func TestSelectorsRejectEmptyCandidates(t *testing.T) {
+	for _, strategy := range []string{SelectorRandom, SelectorRoundRobin, SelectorLeastConnections, SelectorConsistentHash} {
+		sel := NewSelector(strategy)
+		if _, er := sel.Pick(nil); er == nil {
+			t.Fatalf("%s: expected an error picking from no candidates", strategy)
+		}
+	}
+}
+
+func TestRoundRobinCyclesThroughCandidates(t *testing.T) {
+	sel := NewSelector(SelectorRoundRobin)
+	cc := items("a", "b", "c")
+
+	var picked []string
+	for i := 0; i < 6; i++ {
+		it, er := sel.Pick(cc)
+		if er != nil {
+			t.Fatalf("Pick: %v", er)
+		}
+		picked = append(picked, it.ID())
+	}
+
+	want := []string{"a", "b", "c", "a", "b", "c"}
+	for i := range want {
+		if picked[i] != want[i] {
+			t.Fatalf("round-robin order = %v, want %v", picked, want)
+		}
+	}
+}
+
+func TestLeastConnectionsPrefersLeastPicked(t *testing.T) {
+	sel := NewSelector(SelectorLeastConnections)
+	cc := items("a", "b")
+
+	first, _ := sel.Pick(cc)
+	second, _ := sel.Pick(cc)
+	if first.ID() == second.ID() {
+		t.Fatalf("expected the second pick to favor the untouched candidate, got %s twice", first.ID())
+	}
+}
+
+func TestConsistentHashIsStableForSameKeyAndCandidateSet(t *testing.T) {
+	sel := NewSelector(SelectorConsistentHash)
+	ks, ok := sel.(KeyedSelector)
+	if !ok {
+		t.Fatal("consistent-hash selector should implement KeyedSelector")
+	}
+	cc := items("a", "b", "c", "d")
+
+	first, er := ks.PickForKey(cc, "user-42")
+	if er != nil {
+		t.Fatalf("PickForKey: %v", er)
+	}
+	for i := 0; i < 10; i++ {
+		again, er := ks.PickForKey(cc, "user-42")
+		if er != nil {
+			t.Fatalf("PickForKey: %v", er)
+		}
+		if again.ID() != first.ID() {
+			t.Fatalf("consistent-hash picked %s then %s for the same key and candidate set", first.ID(), again.ID())
+		}
+	}
+}
+
+func TestConsistentHashDifferentKeysCanLandDifferently(t *testing.T) {
+	sel := NewSelector(SelectorConsistentHash).(KeyedSelector)
+	cc := items("a", "b", "c", "d", "e", "f", "g", "h")
+
+	seen := map[string]bool{}
+	for i := 0; i < len(cc); i++ {
+		key := string(rune('a' + i))
+		it, er := sel.PickForKey(cc, key)
+		if er != nil {
+			t.Fatalf("PickForKey: %v", er)
+		}
+		seen[it.ID()] = true
+	}
+	if len(seen) < 2 {
+		t.Fatalf("expected distinct keys to spread across more than one candidate, got %v", seen)
+	}
+}